@@ -0,0 +1,84 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bearerTokenFileRoundTripper attaches a bearer token read from a file,
+// reloading it on a timer so a token rotated on disk (e.g. a projected
+// Kubernetes service account token) is picked up without restarting
+// promscale.
+type bearerTokenFileRoundTripper struct {
+	path string
+	next http.RoundTripper
+
+	mu    sync.RWMutex
+	token string
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newBearerTokenFileRoundTripper(cfg *BearerTokenFileConfig, next http.RoundTripper) (*bearerTokenFileRoundTripper, error) {
+	cfg.setDefaults()
+
+	rt := &bearerTokenFileRoundTripper{path: cfg.Path, next: next, done: make(chan struct{})}
+	if err := rt.reload(); err != nil {
+		return nil, err
+	}
+
+	go rt.reloadLoop(cfg.ReloadInterval)
+	return rt, nil
+}
+
+func (rt *bearerTokenFileRoundTripper) reload() error {
+	data, err := os.ReadFile(rt.path)
+	if err != nil {
+		return fmt.Errorf("read bearer token file: %w", err)
+	}
+
+	rt.mu.Lock()
+	rt.token = strings.TrimSpace(string(data))
+	rt.mu.Unlock()
+	return nil
+}
+
+func (rt *bearerTokenFileRoundTripper) reloadLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// A transient read failure (e.g. the file is mid-rewrite) keeps
+			// the previous token in place rather than breaking requests.
+			_ = rt.reload()
+		case <-rt.done:
+			return
+		}
+	}
+}
+
+// Close stops the reload loop. It is safe to call more than once.
+func (rt *bearerTokenFileRoundTripper) Close() error {
+	rt.closeOnce.Do(func() { close(rt.done) })
+	return nil
+}
+
+func (rt *bearerTokenFileRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.RLock()
+	token := rt.token
+	rt.mu.RUnlock()
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return rt.next.RoundTrip(req)
+}
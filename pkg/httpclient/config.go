@@ -0,0 +1,70 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package httpclient builds authenticated http.RoundTrippers for promscale's
+// outbound remote_read/remote_write endpoints, so pushing to (or pulling
+// from) managed Prometheus services like Amazon Managed Prometheus or Google
+// Managed Prometheus doesn't require running an external sidecar proxy just
+// to sign requests.
+package httpclient
+
+import "time"
+
+// Config is the YAML-facing configuration for an outbound remote endpoint's
+// authentication. At most one of SigV4, GoogleOAuth or BearerTokenFile
+// should be set; they are mutually exclusive signing/auth schemes. TLS
+// applies independently of which of those is chosen.
+type Config struct {
+	SigV4           *SigV4Config           `yaml:"sigv4,omitempty"`
+	GoogleOAuth     *GoogleOAuthConfig     `yaml:"google_oauth,omitempty"`
+	BearerTokenFile *BearerTokenFileConfig `yaml:"bearer_token_file,omitempty"`
+	TLS             *TLSConfig             `yaml:"tls_config,omitempty"`
+}
+
+// SigV4Config configures AWS Signature Version 4 request signing.
+type SigV4Config struct {
+	Region    string `yaml:"region,omitempty"`
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+	Profile   string `yaml:"profile,omitempty"`
+	RoleARN   string `yaml:"role_arn,omitempty"`
+}
+
+// GoogleOAuthConfig configures Google Cloud OAuth2 token attachment via
+// Application Default Credentials.
+type GoogleOAuthConfig struct {
+	// Scopes defaults to the monitoring write/read scopes if empty.
+	Scopes []string `yaml:"scopes,omitempty"`
+}
+
+// BearerTokenFileConfig configures reading a bearer token from a file that
+// may be rotated on disk (e.g. a projected Kubernetes service account
+// token), reloading it periodically rather than once at startup.
+type BearerTokenFileConfig struct {
+	Path           string        `yaml:"path"`
+	ReloadInterval time.Duration `yaml:"reload_interval,omitempty"`
+}
+
+func (c *BearerTokenFileConfig) setDefaults() {
+	if c.ReloadInterval <= 0 {
+		c.ReloadInterval = 30 * time.Second
+	}
+}
+
+// TLSConfig configures mTLS with certificates reloaded from disk so rotated
+// certs are picked up without a restart.
+type TLSConfig struct {
+	CAFile             string        `yaml:"ca_file,omitempty"`
+	CertFile           string        `yaml:"cert_file,omitempty"`
+	KeyFile            string        `yaml:"key_file,omitempty"`
+	ServerName         string        `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify,omitempty"`
+	ReloadInterval     time.Duration `yaml:"reload_interval,omitempty"`
+}
+
+func (c *TLSConfig) setDefaults() {
+	if c.ReloadInterval <= 0 {
+		c.ReloadInterval = time.Minute
+	}
+}
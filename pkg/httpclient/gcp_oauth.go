@@ -0,0 +1,55 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// defaultGoogleScopes is used when GoogleOAuthConfig.Scopes is empty, and
+// covers both reading from and writing to Google Managed Service for
+// Prometheus.
+var defaultGoogleScopes = []string{
+	"https://www.googleapis.com/auth/monitoring.write",
+	"https://www.googleapis.com/auth/monitoring.read",
+}
+
+// googleOAuthRoundTripper attaches a bearer token sourced from Application
+// Default Credentials to every outbound request, refreshing it as needed via
+// oauth2.TokenSource's own expiry tracking.
+type googleOAuthRoundTripper struct {
+	source oauth2.TokenSource
+	next   http.RoundTripper
+}
+
+func newGoogleOAuthRoundTripper(cfg *GoogleOAuthConfig, next http.RoundTripper) (http.RoundTripper, error) {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultGoogleScopes
+	}
+
+	creds, err := google.FindDefaultCredentials(context.Background(), scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("find default credentials: %w", err)
+	}
+
+	return &googleOAuthRoundTripper{source: creds.TokenSource, next: next}, nil
+}
+
+func (rt *googleOAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := rt.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("fetch google oauth token: %w", err)
+	}
+
+	req = req.Clone(req.Context())
+	tok.SetAuthHeader(req)
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,104 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// NewRoundTripper wraps next with whichever auth scheme cfg configures,
+// returning next unmodified if cfg is nil or empty. At most one of
+// cfg.SigV4, cfg.GoogleOAuth or cfg.BearerTokenFile may be set.
+//
+// The returned io.Closer stops any background reload goroutine the chosen
+// scheme (or cfg.TLS) started. Callers must close it once the RoundTripper
+// is no longer in use, such as when a remote endpoint's config is rebuilt
+// on reload, or those goroutines leak for the life of the process.
+func NewRoundTripper(cfg *Config, next http.RoundTripper) (rt http.RoundTripper, closer io.Closer, err error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if cfg == nil {
+		return next, nopCloser{}, nil
+	}
+
+	set := 0
+	for _, isSet := range []bool{cfg.SigV4 != nil, cfg.GoogleOAuth != nil, cfg.BearerTokenFile != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, nil, fmt.Errorf("httpclient: at most one of sigv4, google_oauth and bearer_token_file may be configured")
+	}
+
+	// closers collects every reload goroutine started while building this
+	// RoundTripper. If a later step fails, the deferred cleanup below closes
+	// everything collected so far instead of leaking it along with the
+	// error; a successful return passes closers to the caller intact.
+	var closers closerList
+	defer func() {
+		if err != nil {
+			closers.Close()
+		}
+	}()
+
+	if cfg.TLS != nil {
+		tlsRT, tlsCloser, tlsErr := newTLSRoundTripper(cfg.TLS, next)
+		if tlsErr != nil {
+			return nil, nil, fmt.Errorf("configure mTLS: %w", tlsErr)
+		}
+		next = tlsRT
+		closers = append(closers, tlsCloser)
+	}
+
+	switch {
+	case cfg.SigV4 != nil:
+		sigRT, sigErr := newSigV4RoundTripper(cfg.SigV4, next)
+		if sigErr != nil {
+			return nil, nil, fmt.Errorf("configure sigv4: %w", sigErr)
+		}
+		return sigRT, closers, nil
+	case cfg.GoogleOAuth != nil:
+		oauthRT, oauthErr := newGoogleOAuthRoundTripper(cfg.GoogleOAuth, next)
+		if oauthErr != nil {
+			return nil, nil, fmt.Errorf("configure google oauth: %w", oauthErr)
+		}
+		return oauthRT, closers, nil
+	case cfg.BearerTokenFile != nil:
+		tokenRT, tokenErr := newBearerTokenFileRoundTripper(cfg.BearerTokenFile, next)
+		if tokenErr != nil {
+			return nil, nil, fmt.Errorf("configure bearer token file: %w", tokenErr)
+		}
+		closers = append(closers, tokenRT)
+		return tokenRT, closers, nil
+	default:
+		return next, closers, nil
+	}
+}
+
+// nopCloser is returned when cfg is nil, so callers can always defer the
+// returned Closer without a nil check. A non-nil cfg that starts no
+// background goroutine gets an empty closerList, which is also a no-op.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// closerList closes every io.Closer in it, continuing past individual
+// failures so one misbehaving reload loop doesn't leak the rest.
+type closerList []io.Closer
+
+func (c closerList) Close() error {
+	var errs []error
+	for _, closer := range c {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,172 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a throwaway self-signed cert/key pair to dir,
+// just enough for newTLSRoundTripper to accept as a client certificate.
+func writeSelfSignedCert(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %s", err)
+	}
+
+	certPath = filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %s", err)
+	}
+	keyPath = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %s", err)
+	}
+	return certPath, keyPath
+}
+
+// waitForGoroutineCountAtMost polls until runtime.NumGoroutine() drops to at
+// most want, so tests don't race the scheduler tearing down goroutines.
+func waitForGoroutineCountAtMost(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got := runtime.NumGoroutine(); got <= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine count still %d, want at most %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestNewTLSRoundTripperClosesCertReloadOnCAFileError verifies that a later
+// CAFile failure doesn't leak the cert-reload goroutine newTLSRoundTripper
+// already started for a valid CertFile/KeyFile.
+func TestNewTLSRoundTripperClosesCertReloadOnCAFileError(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeSelfSignedCert(t, dir)
+
+	caPath := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caPath, []byte("not a valid PEM bundle"), 0o600); err != nil {
+		t.Fatalf("write bad CA file: %s", err)
+	}
+
+	before := runtime.NumGoroutine()
+
+	_, _, err := newTLSRoundTripper(&TLSConfig{
+		CertFile: certPath,
+		KeyFile:  keyPath,
+		CAFile:   caPath,
+		// A long interval keeps the reload goroutine's ticker from firing
+		// during the test; only the Close on the error path should stop it.
+		ReloadInterval: time.Hour,
+	}, nil)
+	if err == nil {
+		t.Fatal("expected an error loading an invalid CA file")
+	}
+
+	waitForGoroutineCountAtMost(t, before)
+}
+
+// TestNewRoundTripperClosesTLSReloadWhenSchemeFails verifies that a later
+// auth-scheme failure doesn't leak the cert-reload goroutine already started
+// on cfg's behalf by a successfully-configured cfg.TLS.
+func TestNewRoundTripperClosesTLSReloadWhenSchemeFails(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeSelfSignedCert(t, dir)
+
+	before := runtime.NumGoroutine()
+
+	_, _, err := NewRoundTripper(&Config{
+		// A long interval keeps the reload goroutine's ticker from firing
+		// during the test; only the Close on the error path should stop it.
+		TLS: &TLSConfig{CertFile: certPath, KeyFile: keyPath, ReloadInterval: time.Hour},
+		// No Application Default Credentials are available in this
+		// environment, so this reliably fails construction.
+		GoogleOAuth: &GoogleOAuthConfig{},
+	}, nil)
+	if err == nil {
+		t.Fatal("expected an error finding default Google credentials")
+	}
+
+	waitForGoroutineCountAtMost(t, before)
+}
+
+// TestNewRoundTripperCloserStopsReloadLoop verifies that closing the Closer
+// returned alongside a bearer-token-file RoundTripper actually stops its
+// reload goroutine, rather than leaking one per NewRoundTripper call.
+func TestNewRoundTripperCloserStopsReloadLoop(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("token-v1"), 0o600); err != nil {
+		t.Fatalf("write token file: %s", err)
+	}
+
+	before := runtime.NumGoroutine()
+
+	const n = 20
+	closers := make([]interface{ Close() error }, n)
+	for i := 0; i < n; i++ {
+		_, closer, err := NewRoundTripper(&Config{
+			BearerTokenFile: &BearerTokenFileConfig{Path: tokenPath, ReloadInterval: time.Millisecond},
+		}, nil)
+		if err != nil {
+			t.Fatalf("new round tripper: %s", err)
+		}
+		closers[i] = closer
+	}
+
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			t.Fatalf("close: %s", err)
+		}
+		// Closing twice must not panic (e.g. double-close of a channel).
+		if err := closer.Close(); err != nil {
+			t.Fatalf("second close: %s", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if runtime.NumGoroutine() <= before+1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reload goroutines still running after Close: before=%d after=%d", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
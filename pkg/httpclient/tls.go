@@ -0,0 +1,125 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// newTLSRoundTripper wraps next's underlying transport with a tls.Config
+// that reloads the client certificate from disk on a timer, so a rotated
+// client cert takes effect without a restart. The CA bundle, if configured,
+// is read once here and is not reloaded. The
+// returned *reloadingCert is always non-nil and must be closed to stop that
+// reload goroutine, even if no client cert was configured (in which case
+// Close is a no-op).
+func newTLSRoundTripper(cfg *TLSConfig, next http.RoundTripper) (http.RoundTripper, *reloadingCert, error) {
+	cfg.setDefaults()
+
+	rc := &reloadingCert{certFile: cfg.CertFile, keyFile: cfg.KeyFile, done: make(chan struct{})}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if err := rc.reload(); err != nil {
+			return nil, nil, err
+		}
+		go rc.reloadLoop(cfg.ReloadInterval)
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		tlsCfg.GetClientCertificate = rc.getClientCertificate
+	}
+	if cfg.CAFile != "" {
+		pool, err := loadCAPool(cfg.CAFile)
+		if err != nil {
+			// The cert reload goroutine above may already be running; stop
+			// it rather than leaking it, since the caller never receives rc
+			// on this error path.
+			rc.Close()
+			return nil, nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	transport, ok := next.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	} else {
+		transport = transport.Clone()
+	}
+	transport.TLSClientConfig = tlsCfg
+	return transport, rc, nil
+}
+
+func loadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// reloadingCert keeps a client certificate/key pair refreshed from disk so a
+// rotated cert is picked up by new connections without a process restart.
+type reloadingCert struct {
+	certFile, keyFile string
+
+	mu   sync.Mutex
+	cert atomic.Pointer[tls.Certificate]
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (rc *reloadingCert) reload() error {
+	cert, err := tls.LoadX509KeyPair(rc.certFile, rc.keyFile)
+	if err != nil {
+		return fmt.Errorf("load client certificate: %w", err)
+	}
+	rc.cert.Store(&cert)
+	return nil
+}
+
+func (rc *reloadingCert) reloadLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rc.mu.Lock()
+			// A transient read failure (e.g. the file is mid-rewrite by a
+			// cert-manager-style rotator) keeps the previous certificate in
+			// place rather than breaking new connections.
+			_ = rc.reload()
+			rc.mu.Unlock()
+		case <-rc.done:
+			return
+		}
+	}
+}
+
+func (rc *reloadingCert) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return rc.cert.Load(), nil
+}
+
+// Close stops the reload loop, if one was started. It is safe to call more
+// than once, and safe to call even when no client cert was configured.
+func (rc *reloadingCert) Close() error {
+	rc.closeOnce.Do(func() { close(rc.done) })
+	return nil
+}
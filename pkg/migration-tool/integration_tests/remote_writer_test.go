@@ -0,0 +1,115 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package integration_tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/timescale/promscale/pkg/remotewrite"
+)
+
+// remoteWriteServer is the write-side companion to remoteReadServer: it
+// serves remotewrite.Handler on every path of the test server and remembers
+// every series it was asked to ingest.
+type remoteWriteServer struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	series []prompb.TimeSeries
+}
+
+// createRemoteWriteServer creates a remote-write receiver server, mirroring
+// createRemoteReadServer. It returns a server which should be closed after
+// being used.
+func createRemoteWriteServer() (*remoteWriteServer, string) {
+	rws := &remoteWriteServer{}
+	s := httptest.NewServer(remotewrite.NewHandler(rws))
+	rws.server = s
+	return rws, s.URL
+}
+
+func (rws *remoteWriteServer) IngestSeries(_ *http.Request, series []prompb.TimeSeries) error {
+	rws.mu.Lock()
+	defer rws.mu.Unlock()
+	rws.series = append(rws.series, series...)
+	return nil
+}
+
+// Series returns the number of series the remoteWriteServer has ingested.
+func (rws *remoteWriteServer) Series() int {
+	rws.mu.Lock()
+	defer rws.mu.Unlock()
+	return len(rws.series)
+}
+
+// Samples returns the total number of samples the remoteWriteServer has
+// ingested.
+func (rws *remoteWriteServer) Samples() int {
+	rws.mu.Lock()
+	defer rws.mu.Unlock()
+	numSamples := 0
+	for _, s := range rws.series {
+		numSamples += len(s.Samples)
+	}
+	return numSamples
+}
+
+// Close closes the server.
+func (rws *remoteWriteServer) Close() {
+	rws.server.Close()
+}
+
+// TestRemoteWriteServerIngestsValidRequest verifies that pushing a
+// well-formed, properly-headered write request through createRemoteWriteServer
+// lands in the server's recorded series, exercising the same request shape
+// promscale's own remote-write client sends.
+func TestRemoteWriteServerIngestsValidRequest(t *testing.T) {
+	rws, url := createRemoteWriteServer()
+	defer rws.Close()
+
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "test_metric"}},
+			Samples: []prompb.Sample{{Timestamp: 0, Value: 1}, {Timestamp: 1000, Value: 2}},
+		}},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal write request: %s", err)
+	}
+
+	compressed := snappy.Encode(nil, data)
+	postReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("create request: %s", err)
+	}
+	postReq.Header.Set("Content-Encoding", "snappy")
+	postReq.Header.Set("Content-Type", "application/x-protobuf")
+	postReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	postResp, err := http.DefaultClient.Do(postReq)
+	if err != nil {
+		t.Fatalf("execute request: %s", err)
+	}
+	defer postResp.Body.Close()
+
+	if postResp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status: %s", postResp.Status)
+	}
+	if rws.Series() != 1 {
+		t.Fatalf("expected 1 series, got %d", rws.Series())
+	}
+	if rws.Samples() != 2 {
+		t.Fatalf("expected 2 samples, got %d", rws.Samples())
+	}
+}
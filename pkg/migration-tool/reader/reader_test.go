@@ -0,0 +1,41 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package reader
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// TestSeriesKeyDoesNotCollideOnSeparatorBytes verifies that two distinct
+// label sets whose values happen to contain the byte a naive "name=value;"
+// concatenation would use as a separator don't get merged into the same
+// dedup key.
+func TestSeriesKeyDoesNotCollideOnSeparatorBytes(t *testing.T) {
+	a := []prompb.Label{
+		{Name: "a", Value: "b;c"},
+		{Name: "d", Value: "e"},
+	}
+	b := []prompb.Label{
+		{Name: "a", Value: "b"},
+		{Name: "c;d", Value: "e"},
+	}
+
+	if got := seriesKey(a); got == seriesKey(b) {
+		t.Fatalf("distinct label sets produced the same key: %q", got)
+	}
+}
+
+// TestSeriesKeyIgnoresLabelOrder verifies that the same label set produces
+// the same key regardless of the order labels arrive in.
+func TestSeriesKeyIgnoresLabelOrder(t *testing.T) {
+	a := []prompb.Label{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}
+	b := []prompb.Label{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}}
+
+	if seriesKey(a) != seriesKey(b) {
+		t.Fatalf("expected the same key regardless of label order, got %q and %q", seriesKey(a), seriesKey(b))
+	}
+}
@@ -0,0 +1,87 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package remotewrite implements a first-class Prometheus remote-write
+// receiver endpoint as an http.Handler. The package registers no route and
+// defines no command-line flag; mounting the Handler (e.g. at /write) is up
+// to the caller.
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+const remoteWriteVersion = "0.1.0"
+
+// Sink ingests a decoded, already-validated write request. Implementations
+// should return an *InvalidRequestError for payload problems (out-of-order
+// samples, invalid label sets) so the Handler can answer with 400 instead of
+// 500, matching Prometheus' own receiver behavior.
+type Sink interface {
+	IngestSeries(r *http.Request, series []prompb.TimeSeries) error
+}
+
+// Handler is an http.Handler implementing the remote-write receiver
+// endpoint. It deliberately never caches series refs per connection: an
+// attacker pushing a stream of unique label sets would otherwise grow that
+// cache without bound, so every request always takes the slower,
+// re-validate-everything path instead.
+type Handler struct {
+	sink Sink
+}
+
+// NewHandler creates a Handler that hands decoded, validated series to sink.
+func NewHandler(sink Sink) *Handler {
+	return &Handler{sink: sink}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if enc := r.Header.Get("Content-Encoding"); enc != "snappy" {
+		http.Error(w, fmt.Sprintf("unsupported Content-Encoding %q, expected snappy", enc), http.StatusBadRequest)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		http.Error(w, fmt.Sprintf("unsupported Content-Type %q, expected application/x-protobuf", ct), http.StatusBadRequest)
+		return
+	}
+
+	if v := r.Header.Get("X-Prometheus-Remote-Write-Version"); v != remoteWriteVersion {
+		http.Error(w, fmt.Sprintf("unsupported X-Prometheus-Remote-Write-Version %q, expected %s", v, remoteWriteVersion), http.StatusBadRequest)
+		return
+	}
+
+	req, err := remote.DecodeWriteRequest(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode write request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSeries(req.Timeseries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.sink.IngestSeries(r, req.Timeseries); err != nil {
+		var invalid *InvalidRequestError
+		if errors.As(err, &invalid) {
+			http.Error(w, invalid.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal error ingesting series", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,143 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package remotewrite
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+type noopSink struct{}
+
+func (noopSink) IngestSeries(*http.Request, []prompb.TimeSeries) error { return nil }
+
+func validWriteRequestBody(tb testing.TB) []byte {
+	tb.Helper()
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "test_metric"}},
+			Samples: []prompb.Sample{{Timestamp: 0, Value: 1}, {Timestamp: 1000, Value: 2}},
+		}},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		tb.Fatalf("marshal write request: %s", err)
+	}
+	return snappy.Encode(nil, data)
+}
+
+func newWriteRequest(tb testing.TB, body []byte) *http.Request {
+	tb.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	return req
+}
+
+func TestHandlerRejectsNonPOST(t *testing.T) {
+	h := NewHandler(noopSink{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/write", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestHandlerRejectsWrongContentEncoding(t *testing.T) {
+	h := NewHandler(noopSink{})
+	req := newWriteRequest(t, validWriteRequestBody(t))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandlerRejectsWrongContentType(t *testing.T) {
+	h := NewHandler(noopSink{})
+	req := newWriteRequest(t, validWriteRequestBody(t))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandlerRejectsWrongVersion(t *testing.T) {
+	h := NewHandler(noopSink{})
+	req := newWriteRequest(t, validWriteRequestBody(t))
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.2.0")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandlerRejectsOutOfOrderSamples(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "test_metric"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 500, Value: 2}},
+		}},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal write request: %s", err)
+	}
+
+	h := NewHandler(noopSink{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newWriteRequest(t, snappy.Encode(nil, data)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for out-of-order samples, got %d", rec.Code)
+	}
+}
+
+func TestHandlerAcceptsValidRequest(t *testing.T) {
+	h := NewHandler(noopSink{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newWriteRequest(t, validWriteRequestBody(t)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+}
+
+func FuzzHandlerServeHTTP(f *testing.F) {
+	f.Add(validWriteRequestBody(f))
+	f.Add([]byte{})
+	f.Add([]byte("not snappy at all"))
+
+	h := NewHandler(noopSink{})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		rec := httptest.NewRecorder()
+		// The handler must never panic on malformed input, regardless of
+		// whether it's valid snappy, valid proto, or neither.
+		h.ServeHTTP(rec, newWriteRequest(t, body))
+	})
+}
+
+func BenchmarkHandlerServeHTTP(b *testing.B) {
+	h := NewHandler(noopSink{})
+	body := validWriteRequestBody(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newWriteRequest(b, body))
+	}
+}
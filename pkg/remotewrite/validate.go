@@ -0,0 +1,95 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package remotewrite
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// InvalidRequestError marks a problem with the request payload itself
+// (as opposed to an internal ingestion failure), so the receiver can answer
+// with 400 rather than 500.
+type InvalidRequestError struct {
+	msg string
+}
+
+func (e *InvalidRequestError) Error() string { return e.msg }
+
+func invalidRequestErrorf(format string, args ...interface{}) *InvalidRequestError {
+	return &InvalidRequestError{msg: fmt.Sprintf(format, args...)}
+}
+
+// validateSeries checks every series' label set and sample ordering,
+// returning an *InvalidRequestError describing the first problem found.
+func validateSeries(series []prompb.TimeSeries) error {
+	for i, s := range series {
+		lbls := make(labels.Labels, 0, len(s.Labels))
+		for _, l := range s.Labels {
+			lbls = append(lbls, labels.Label{Name: l.Name, Value: l.Value})
+		}
+
+		if err := validateLabels(lbls); err != nil {
+			return invalidRequestErrorf("series %d: %s", i, err)
+		}
+
+		if err := validateSampleOrder(s.Samples); err != nil {
+			return invalidRequestErrorf("series %d (%s): %s", i, lbls.String(), err)
+		}
+	}
+	return nil
+}
+
+func validateLabels(lbls labels.Labels) error {
+	if lbls.Len() == 0 {
+		return fmt.Errorf("empty label set")
+	}
+	if !lbls.Has(labels.MetricName) {
+		return fmt.Errorf("missing __name__ label")
+	}
+
+	seen := make(map[string]struct{}, lbls.Len())
+	for _, l := range lbls {
+		if l.Name == "" {
+			return fmt.Errorf("empty label name")
+		}
+		if !isValidLabelName(l.Name) {
+			return fmt.Errorf("invalid label name %q", l.Name)
+		}
+		if _, dup := seen[l.Name]; dup {
+			return fmt.Errorf("duplicate label %q", l.Name)
+		}
+		seen[l.Name] = struct{}{}
+	}
+	return nil
+}
+
+// isValidLabelName mirrors model.LabelName.IsValid without pulling in the
+// whole common/model dependency just for this one check.
+func isValidLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, b := range []byte(name) {
+		if !((b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || (b >= '0' && b <= '9' && i > 0)) {
+			return false
+		}
+	}
+	return true
+}
+
+func validateSampleOrder(samples []prompb.Sample) error {
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Timestamp < samples[i-1].Timestamp {
+			return fmt.Errorf("out-of-order samples: timestamp %d after %d", samples[i].Timestamp, samples[i-1].Timestamp)
+		}
+		if samples[i].Timestamp == samples[i-1].Timestamp {
+			return fmt.Errorf("duplicate sample timestamp %d", samples[i].Timestamp)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package walingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// checkpointState is the on-disk representation of a checkpoint: the WAL
+// segment and byte offset within it immediately after the last record that
+// was successfully handed to the Sink.
+type checkpointState struct {
+	Segment int   `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// checkpoint persists a checkpointState to a file, writing atomically so a
+// crash mid-write can never leave a torn, unreadable checkpoint behind.
+type checkpoint struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newCheckpoint(path string) *checkpoint {
+	return &checkpoint{path: path}
+}
+
+// Load returns the last saved checkpoint, or (0, 0, nil) if none exists yet,
+// meaning the tailer should start from the first WAL segment.
+func (c *checkpoint) Load() (segment int, offset int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("read checkpoint file: %w", err)
+	}
+
+	var s checkpointState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return 0, 0, fmt.Errorf("unmarshal checkpoint file: %w", err)
+	}
+	return s.Segment, s.Offset, nil
+}
+
+// Save persists segment/offset, replacing any previous checkpoint.
+func (c *checkpoint) Save(segment int, offset int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(checkpointState{Segment: segment, Offset: offset})
+	if err != nil {
+		return fmt.Errorf("marshal checkpoint: %w", err)
+	}
+
+	dir := filepath.Dir(c.path)
+	tmp, err := os.CreateTemp(dir, ".checkpoint-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp checkpoint file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp checkpoint file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp checkpoint file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp checkpoint file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("rename checkpoint file into place: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package walingest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type work struct {
+	b      Batch
+	result chan error
+}
+
+// ShardedQueue fans batches out across a fixed number of per-shard queues,
+// keyed by the first series ref in the batch, and drains each shard into the
+// underlying Sink on its own goroutine. ShardedQueue itself implements Sink:
+// IngestBatch blocks until the batch has actually been ingested downstream,
+// so callers (the Tailer, in particular) only checkpoint work that has truly
+// landed.
+type ShardedQueue struct {
+	sink     Sink
+	capacity int
+
+	// mu guards shards. It also doubles as the synchronization that makes
+	// closing a shard's channel during Reshard safe: IngestBatch holds a
+	// read lock for as long as it might send on a shard channel, and
+	// Reshard holds the write lock for the entire reshard (not just the
+	// close), so no IngestBatch call can ever observe a shard channel that
+	// has been, or is about to be, closed out from under it (see Reshard).
+	mu     sync.RWMutex
+	shards []chan work
+	// pending counts, per shard, batches that have been handed to that
+	// shard's channel but not yet finished processing (queued or actively
+	// being handled by run). It is read/written without mu: Reshard needs
+	// to hold mu for the whole reshard, including the wg.Wait() below, and
+	// IngestBatch/run must still be able to update it during that wait
+	// without deadlocking on mu. It only ever increments while the caller
+	// holds mu's read lock (in IngestBatch, right after a successful send),
+	// so while Reshard holds the write lock, every shard's count can only
+	// go down, never back up — letting Reshard check each shard in turn
+	// without a later shard's buffered work un-zeroing an earlier one.
+	pending []atomic.Int64
+	wg      sync.WaitGroup
+}
+
+// NewShardedQueue creates a ShardedQueue with n shards, each buffering up to
+// capacity in-flight batches.
+func NewShardedQueue(n, capacity int, sink Sink) *ShardedQueue {
+	q := &ShardedQueue{sink: sink, capacity: capacity}
+	q.start(n)
+	return q
+}
+
+func (q *ShardedQueue) start(n int) {
+	q.shards = make([]chan work, n)
+	q.pending = make([]atomic.Int64, n)
+
+	for i := range q.shards {
+		ch := make(chan work, q.capacity)
+		q.shards[i] = ch
+		q.wg.Add(1)
+		go q.run(i, ch)
+	}
+}
+
+// run drains ch until it is closed, so a shard shutdown (Reshard closing its
+// channel) always finishes handling every already-enqueued batch instead of
+// racing a pending send the way a separate done-channel select would.
+func (q *ShardedQueue) run(i int, ch chan work) {
+	defer q.wg.Done()
+	for w := range ch {
+		err := q.sink.IngestBatch(context.Background(), w.b)
+		q.pending[i].Add(-1)
+		w.result <- err
+	}
+}
+
+// IngestBatch routes b to the shard owning its first series ref and blocks
+// until the underlying Sink has ingested it (or ctx is canceled), which is
+// how back-pressure from a slow Sink propagates back to the WAL tailer.
+func (q *ShardedQueue) IngestBatch(ctx context.Context, b Batch) error {
+	q.mu.RLock()
+	idx := q.shardFor(refOf(b))
+	shard := q.shards[idx]
+	w := work{b: b, result: make(chan error, 1)}
+	select {
+	case shard <- w:
+		q.pending[idx].Add(1)
+		q.mu.RUnlock()
+	case <-ctx.Done():
+		q.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-w.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func refOf(b Batch) uint64 {
+	switch {
+	case len(b.Samples) > 0:
+		return uint64(b.Samples[0].Ref)
+	case len(b.Series) > 0:
+		return uint64(b.Series[0].Ref)
+	default:
+		return 0
+	}
+}
+
+func (q *ShardedQueue) shardFor(ref uint64) int {
+	return int(ref % uint64(len(q.shards)))
+}
+
+// Reshard changes the number of shards to n. It refuses to do so while any
+// shard has outstanding work (queued or actively being handled by run),
+// since closing that shard's channel and then waiting for it to drain (see
+// run) could hang indefinitely if the Sink itself does. Checking what's
+// actually outstanding, rather than how long ago a shard last flushed
+// successfully, means a shard that is idle because it has simply never seen
+// traffic is immediately reshardable instead of being refused forever once
+// it ages past some fixed window. Checking every shard's count in turn is
+// safe even though it takes time to get through all of them: holding mu's
+// write lock for the whole check blocks any new IngestBatch send (see
+// pending's doc comment), so once a shard's count is observed at zero it
+// cannot become nonzero again before Reshard closes its channel below.
+func (q *ShardedQueue) Reshard(n int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.pending {
+		if outstanding := q.pending[i].Load(); outstanding != 0 {
+			return fmt.Errorf("shard %d has %d batch(es) outstanding, refusing to reshard", i, outstanding)
+		}
+	}
+
+	// Closing each shard's channel while holding the write lock guarantees no
+	// IngestBatch call is concurrently sending on it (every sender holds the
+	// read lock for the duration of its send), so run's "for w := range ch"
+	// always sees every already-enqueued batch before the channel closes.
+	// The write lock stays held across wg.Wait() too (run no longer needs mu
+	// to record a flush), so no new IngestBatch call can pick up one of
+	// these now-closed channels before start below replaces them.
+	for _, ch := range q.shards {
+		close(ch)
+	}
+	q.wg.Wait()
+
+	q.start(n)
+	return nil
+}
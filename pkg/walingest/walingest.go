@@ -0,0 +1,266 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package walingest tails a Prometheus-style TSDB WAL directory on disk and
+// hands decoded series/sample batches to a downstream ingestor, as an
+// alternative to accepting only HTTP remote-write pushes. It is meant to sit
+// next to a Prometheus instance (or anything that writes a compatible WAL,
+// e.g. the agent mode) and back-fill the same data an HTTP receiver would
+// have gotten, with the WAL acting as a durable, replayable queue.
+package walingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+// Batch is a decoded slice of a WAL segment, ready to be handed to an
+// ingestor. Segment/Offset identify the position in the WAL immediately
+// after the last record included in the batch, i.e. where a restart should
+// resume reading from.
+type Batch struct {
+	Series  []record.RefSeries
+	Samples []record.RefSample
+	Segment int
+	Offset  int64
+}
+
+func (b *Batch) empty() bool {
+	return len(b.Series) == 0 && len(b.Samples) == 0
+}
+
+func (b *Batch) reset() {
+	b.Series = b.Series[:0]
+	b.Samples = b.Samples[:0]
+}
+
+// Sink receives decoded batches from a Tailer. IngestBatch must block for as
+// long as the downstream ingestor is unable to keep up; the Tailer relies on
+// this to provide back-pressure instead of buffering an unbounded amount of
+// WAL data in memory.
+type Sink interface {
+	IngestBatch(ctx context.Context, b Batch) error
+}
+
+// Config configures a Tailer.
+type Config struct {
+	// Dir is the WAL directory to tail, e.g. <prometheus-data>/wal.
+	Dir string
+	// CheckpointPath is where the last successfully-ingested (segment,
+	// offset) is persisted so a restart can resume without re-ingesting
+	// already-flushed data or losing unflushed data.
+	CheckpointPath string
+	// PollInterval is how often the tailer checks the currently open
+	// segment for newly appended records and checks for new segments.
+	// A ticker is used rather than fsnotify so behavior is identical
+	// across filesystems and container setups where inotify is flaky.
+	PollInterval time.Duration
+	// MaxSamplesPerBatch bounds how many samples are accumulated before
+	// being flushed to the Sink.
+	MaxSamplesPerBatch int
+}
+
+func (c *Config) setDefaults() {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 100 * time.Millisecond
+	}
+	if c.MaxSamplesPerBatch <= 0 {
+		c.MaxSamplesPerBatch = 5000
+	}
+}
+
+// Tailer reads RefSeries/RefSample records from a WAL directory as they are
+// written and hands batches to a Sink, checkpointing its progress so restarts
+// resume from the last commit point instead of replaying the whole WAL.
+type Tailer struct {
+	cfg  Config
+	sink Sink
+	cp   *checkpoint
+}
+
+// NewTailer creates a Tailer for the given Config and Sink.
+func NewTailer(cfg Config, sink Sink) (*Tailer, error) {
+	cfg.setDefaults()
+	if cfg.Dir == "" {
+		return nil, errors.New("walingest: Dir must be set")
+	}
+	if cfg.CheckpointPath == "" {
+		return nil, errors.New("walingest: CheckpointPath must be set")
+	}
+	return &Tailer{
+		cfg:  cfg,
+		sink: sink,
+		cp:   newCheckpoint(cfg.CheckpointPath),
+	}, nil
+}
+
+// Run tails the WAL until ctx is canceled or an unrecoverable error occurs.
+// It resumes from the last checkpoint, if any.
+func (t *Tailer) Run(ctx context.Context) error {
+	segIdx, offset, err := t.cp.Load()
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+
+	for {
+		first, last, err := wlog.Segments(t.cfg.Dir)
+		if err != nil {
+			return fmt.Errorf("list wal segments: %w", err)
+		}
+
+		if segIdx < first {
+			// The checkpointed segment is no longer on disk (e.g. pruned by
+			// retention); resume from the oldest segment that still is.
+			segIdx, offset = first, 0
+		}
+		if segIdx > last {
+			// Nothing to tail yet, or everything that currently exists has
+			// been drained. Wait for a new segment to appear (Prometheus
+			// rotates segments at ~128MiB) before re-listing the directory.
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(t.cfg.PollInterval):
+			}
+			continue
+		}
+
+		if err := t.tailSegment(ctx, segIdx, offset, segIdx == last); err != nil {
+			return fmt.Errorf("tail segment %d: %w", segIdx, err)
+		}
+		segIdx++
+		offset = 0
+	}
+}
+
+// tailSegment reads segIdx, discarding whatever was already delivered and
+// checkpointed up to startOffset. If last is true, the segment was the most
+// recently created one the last time the caller listed the WAL directory, so
+// it may still be appended to by the writer: the reader polls for more data,
+// and periodically re-lists the directory so a rotation to a new segment is
+// noticed, instead of polling a now-stale file forever.
+func (t *Tailer) tailSegment(ctx context.Context, segIdx int, startOffset int64, last bool) error {
+	segFile, err := wlog.OpenReadSegment(wlog.SegmentName(t.cfg.Dir, segIdx))
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	defer segFile.Close()
+
+	// wlog.Segment has no Seek (it only exposes the SegmentFile interface,
+	// which doesn't declare one), and the WAL's on-disk format is paged, so
+	// an arbitrary byte offset isn't a valid place to start decoding from
+	// anyway. Instead, always read the segment from the start and discard
+	// records whose end falls at or before startOffset: they were already
+	// delivered and checkpointed in a previous run.
+	reader := wlog.NewLiveReader(nil, nil, segFile)
+	dec := record.Decoder{}
+	batch := Batch{Segment: segIdx}
+
+	drain := func() error {
+		for reader.Next() {
+			rec := reader.Record()
+			recOffset := reader.Offset()
+			deliver := recOffset > startOffset
+
+			switch dec.Type(rec) {
+			case record.Series:
+				series, err := dec.Series(rec, nil)
+				if err != nil {
+					return fmt.Errorf("decode series record: %w", err)
+				}
+				if deliver {
+					batch.Series = append(batch.Series, series...)
+				}
+			case record.Samples:
+				samples, err := dec.Samples(rec, nil)
+				if err != nil {
+					return fmt.Errorf("decode samples record: %w", err)
+				}
+				if deliver {
+					batch.Samples = append(batch.Samples, samples...)
+				}
+			default:
+				// Tombstones, exemplars, metadata, etc. are not relevant to
+				// remote-write ingestion and are skipped.
+			}
+
+			if deliver && len(batch.Samples) >= t.cfg.MaxSamplesPerBatch {
+				batch.Offset = recOffset
+				if err := t.flush(ctx, &batch); err != nil {
+					return err
+				}
+			}
+		}
+		if err := reader.Err(); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read wal record: %w", err)
+		}
+		return nil
+	}
+
+	if !last {
+		// A fully-written, rotated-away-from segment: drain whatever is left
+		// and move on to the next one.
+		if err := drain(); err != nil {
+			return err
+		}
+		batch.Offset = reader.Offset()
+		return t.flush(ctx, &batch)
+	}
+
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := drain(); err != nil {
+			return err
+		}
+		batch.Offset = reader.Offset()
+		if err := t.flush(ctx, &batch); err != nil {
+			return err
+		}
+
+		if _, newLast, err := wlog.Segments(t.cfg.Dir); err != nil {
+			return fmt.Errorf("list wal segments: %w", err)
+		} else if newLast > segIdx {
+			// The writer has rotated to a new segment: this one is done
+			// growing. Drain whatever trickled in since the check above,
+			// then hand off to Run to move on to the new segment.
+			if err := drain(); err != nil {
+				return err
+			}
+			batch.Offset = reader.Offset()
+			return t.flush(ctx, &batch)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tailer) flush(ctx context.Context, batch *Batch) error {
+	if batch.empty() {
+		return nil
+	}
+
+	// IngestBatch is expected to block while the downstream is backed up,
+	// which in turn stalls this loop and leaves unread WAL data on disk
+	// instead of buffering it in memory.
+	if err := t.sink.IngestBatch(ctx, *batch); err != nil {
+		return fmt.Errorf("ingest batch: %w", err)
+	}
+	if err := t.cp.Save(batch.Segment, batch.Offset); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	batch.reset()
+	return nil
+}